@@ -0,0 +1,458 @@
+// Copyright 2017-2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package collector implements a Prometheus collector that scrapes the
+// NATS server monitoring endpoints (varz, connz, routez, subsz, healthz,
+// leafz, jsz, accounts, ...) and turns them into Prometheus metrics.
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+)
+
+// The systems that NewCollector can scrape. Each system owns a set of
+// endpoints and a metric name prefix.
+const (
+	CoreSystem       = "core"
+	JetStreamSystem  = "jetstream"
+	ReplicatorSystem = "nats-replicator"
+)
+
+// defaultStaleness is how long a just-completed fetch result is handed out
+// to later callers without re-issuing the HTTP request.
+const defaultStaleness = 100 * time.Millisecond
+
+// defaultRequestTimeout bounds a single HTTP fetch against a monitoring
+// endpoint.
+const defaultRequestTimeout = 5 * time.Second
+
+// CollectedServer identifies a single NATS server instance to scrape.
+type CollectedServer struct {
+	ID  string
+	URL string
+}
+
+// cachedResponse is a recently fetched, still-fresh HTTP response body.
+type cachedResponse struct {
+	body    []byte
+	fetched time.Time
+}
+
+// NATSCollector is a prometheus.Collector that scrapes one monitoring
+// endpoint (e.g. "varz", "jsz") across a set of NATS servers belonging to
+// one system (CoreSystem, JetStreamSystem, ...).
+type NATSCollector struct {
+	sync.Mutex
+
+	httpClient *http.Client
+	system     string
+	endpoint   string
+	prefix     string
+	servers    []*CollectedServer
+
+	// Stats holds the metrics produced by the most recent Collect (or, for
+	// a freshly constructed collector, the metrics produced while probing
+	// the servers in NewCollector).
+	Stats []prometheus.Metric
+
+	logger Logger
+
+	// flight coalesces concurrent fetches of the same system+endpoint+URL
+	// so that overlapping Collect calls share one in-flight HTTP request.
+	flight    singleflight.Group
+	staleness time.Duration
+
+	cacheMu sync.Mutex
+	cache   map[string]cachedResponse
+}
+
+// NewCollector creates a new NATS collector that scrapes endpoint for every
+// server in servers, naming its metrics "<prefix>_<endpoint>_<field>" (the
+// prefix defaults to the conventional one for the given system when empty).
+// The jsz and accounts endpoints are the exception: their metrics are named
+// "<prefix>_<level>_<field>" (server, stream, consumer, account, cluster).
+// By default diagnostics are discarded; pass WithLogger to capture them.
+func NewCollector(system, endpoint, prefix string, servers []*CollectedServer, opts ...Option) prometheus.Collector {
+	if prefix == "" {
+		prefix = defaultPrefixForSystem(system)
+	}
+
+	nc := &NATSCollector{
+		httpClient: &http.Client{Timeout: defaultRequestTimeout},
+		system:     system,
+		endpoint:   endpoint,
+		prefix:     prefix,
+		servers:    dedupeServers(servers),
+		staleness:  defaultStaleness,
+		cache:      make(map[string]cachedResponse),
+		logger:     noopLogger{},
+	}
+	for _, opt := range opts {
+		opt(nc)
+	}
+
+	nc.Stats = nc.collectStats()
+	return nc
+}
+
+// WithStaleness overrides the default ~100ms window during which a
+// just-completed fetch result is handed to later callers without
+// re-issuing the HTTP request. Pass 0 to disable the window and always
+// fetch fresh (subject to singleflight coalescing of truly concurrent
+// callers).
+func WithStaleness(d time.Duration) Option {
+	return func(nc *NATSCollector) {
+		nc.staleness = d
+	}
+}
+
+func defaultPrefixForSystem(system string) string {
+	switch system {
+	case CoreSystem:
+		return "gnatsd"
+	case JetStreamSystem:
+		return "jetstream"
+	case ReplicatorSystem:
+		return "nats_replicator"
+	default:
+		return system
+	}
+}
+
+func dedupeServers(servers []*CollectedServer) []*CollectedServer {
+	seen := make(map[string]bool, len(servers))
+	out := make([]*CollectedServer, 0, len(servers))
+	for _, s := range servers {
+		if s == nil || seen[s.URL] {
+			continue
+		}
+		seen[s.URL] = true
+		out = append(out, s)
+	}
+	return out
+}
+
+// Describe implements prometheus.Collector.
+func (nc *NATSCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range nc.collectStats() {
+		ch <- m.Desc()
+	}
+}
+
+// Collect implements prometheus.Collector. It is safe to call concurrently;
+// overlapping calls targeting the same server+endpoint share one HTTP fetch
+// via the collector's singleflight.Group.
+func (nc *NATSCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := nc.collectStats()
+
+	nc.Lock()
+	nc.Stats = stats
+	nc.Unlock()
+
+	for _, m := range stats {
+		ch <- m
+	}
+}
+
+func (nc *NATSCollector) collectStats() []prometheus.Metric {
+	var metrics []prometheus.Metric
+	for _, s := range nc.servers {
+		body, err := nc.fetch(s)
+		if err != nil {
+			nc.logger.Warnf("could not fetch %s %s from %s: %v", nc.system, nc.endpoint, s.URL, err)
+			continue
+		}
+
+		m, err := nc.buildMetrics(s, body)
+		if err != nil {
+			nc.logger.Warnf("could not parse %s %s response from %s: %v", nc.system, nc.endpoint, s.URL, err)
+			continue
+		}
+		for _, metric := range m {
+			nc.logger.Debugf("emitting metric %s for server %s", metric.Desc().String(), s.ID)
+		}
+		metrics = append(metrics, m...)
+	}
+	return metrics
+}
+
+// fetch returns the raw JSON body for the collector's endpoint on s,
+// coalescing concurrent callers behind a singleflight.Group keyed by
+// system+endpoint+server URL, and serving a just-fetched body directly for
+// nc.staleness before issuing a new request.
+func (nc *NATSCollector) fetch(s *CollectedServer) ([]byte, error) {
+	key := nc.system + "|" + nc.endpoint + "|" + s.URL
+
+	nc.cacheMu.Lock()
+	cached, ok := nc.cache[key]
+	nc.cacheMu.Unlock()
+	if ok && time.Since(cached.fetched) < nc.staleness {
+		return cached.body, nil
+	}
+
+	v, err, _ := nc.flight.Do(key, func() (interface{}, error) {
+		body, ferr := nc.doFetch(s)
+		if ferr != nil {
+			return nil, ferr
+		}
+		nc.cacheMu.Lock()
+		nc.cache[key] = cachedResponse{body: body, fetched: time.Now()}
+		nc.cacheMu.Unlock()
+		return body, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+func (nc *NATSCollector) doFetch(s *CollectedServer) ([]byte, error) {
+	path := nc.endpoint
+	switch nc.endpoint {
+	case "jsz":
+		path = "jsz?accounts=true&streams=true&consumers=true"
+	case "accounts":
+		// Per-account JetStream usage is served by /jsz.
+		path = "jsz?accounts=true"
+	}
+	url := strings.TrimRight(s.URL, "/") + "/" + path
+	resp, err := nc.httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// buildMetrics dispatches to the endpoint-specific metric builder for
+// nc.endpoint, falling back to a generic flatten-the-JSON builder for
+// endpoints without bespoke handling.
+func (nc *NATSCollector) buildMetrics(s *CollectedServer, body []byte) ([]prometheus.Metric, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	if nc.system == ReplicatorSystem && replicatorEndpoints[nc.endpoint] {
+		return nc.buildReplicatorMetrics(s, raw), nil
+	}
+
+	switch nc.endpoint {
+	case "healthz":
+		return nc.buildHealthzMetrics(s, raw), nil
+	case "leafz":
+		return nc.buildLeafzMetrics(s, raw), nil
+	case "jsz":
+		return nc.buildJszMetrics(s, raw), nil
+	case "accounts":
+		return nc.buildAccountsMetrics(s, raw), nil
+	default:
+		return nc.buildGenericMetrics(s, raw, nil), nil
+	}
+}
+
+// buildGenericMetrics flattens every numeric (or boolean) leaf of raw into a
+// gauge named "<prefix>_<endpoint>_<flattened path>", labeled with
+// server_id plus any extraLabels.
+func (nc *NATSCollector) buildGenericMetrics(s *CollectedServer, raw map[string]any, extraLabels prometheus.Labels) []prometheus.Metric {
+	values := flattenNumeric(raw, "")
+
+	metrics := make([]prometheus.Metric, 0, len(values))
+	for name, val := range values {
+		labels := prometheus.Labels{"server_id": s.ID}
+		for k, v := range extraLabels {
+			labels[k] = v
+		}
+		metrics = append(metrics, nc.newGauge(name, val, labels))
+	}
+	return metrics
+}
+
+func (nc *NATSCollector) newGauge(name string, value float64, labels prometheus.Labels) prometheus.Metric {
+	return nc.newGaugeFQ(nc.endpoint+"_"+name, value, labels)
+}
+
+// newGaugeFQ builds a gauge named "<prefix>_<suffix>", bypassing the
+// "<endpoint>_" segment that newGauge inserts. Used by roll-up metrics
+// (e.g. "account_memory_used", "cluster_memory_used") whose name reflects
+// an aggregation level rather than the endpoint that sourced them.
+func (nc *NATSCollector) newGaugeFQ(suffix string, value float64, labels prometheus.Labels) prometheus.Metric {
+	labelNames := make([]string, 0, len(labels))
+	labelValues := make([]string, 0, len(labels))
+	for k, v := range labels {
+		labelNames = append(labelNames, k)
+		labelValues = append(labelValues, v)
+	}
+
+	fqName := nc.prefix + "_" + suffix
+	desc := prometheus.NewDesc(fqName, fqName, labelNames, nil)
+	return prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labelValues...)
+}
+
+// buildHealthzMetrics turns the "status" string of a /healthz response into
+// two gauges: status (0 == ok, matching the server's own exit-code
+// convention) and status_value (1 == ok).
+func (nc *NATSCollector) buildHealthzMetrics(s *CollectedServer, raw map[string]any) []prometheus.Metric {
+	labels := prometheus.Labels{"server_id": s.ID}
+
+	status, _ := raw["status"].(string)
+	statusCode := 0.0
+	statusValue := 1.0
+	if !strings.EqualFold(status, "ok") {
+		statusCode = 1
+		statusValue = 0
+	}
+
+	return []prometheus.Metric{
+		nc.newGauge("status", statusCode, labels),
+		nc.newGauge("status_value", statusValue, labels),
+	}
+}
+
+// buildLeafzMetrics emits one set of gauges per leaf connection, labeled by
+// that connection's name/account/ip/port in addition to server_id.
+func (nc *NATSCollector) buildLeafzMetrics(s *CollectedServer, raw map[string]any) []prometheus.Metric {
+	leafs, _ := raw["leafs"].([]any)
+
+	var metrics []prometheus.Metric
+	for _, l := range leafs {
+		leaf, ok := l.(map[string]any)
+		if !ok {
+			continue
+		}
+		labels := prometheus.Labels{
+			"server_id": s.ID,
+			"name":      stringField(leaf, "name"),
+			"account":   stringField(leaf, "account"),
+			"ip":        stringField(leaf, "ip"),
+			"port":      fmt.Sprint(leaf["port"]),
+		}
+		for name, val := range flattenNumeric(leaf, "conn") {
+			metrics = append(metrics, nc.newGauge(name, val, labels))
+		}
+	}
+	return metrics
+}
+
+func stringField(m map[string]any, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// flattenNumeric walks m (and any nested objects) and returns every
+// numeric/boolean leaf as a "<prefix>_<path>" -> value map, joining nested
+// keys with underscores. Non-numeric leaves (strings, arrays) are skipped;
+// callers that need them handle those fields explicitly.
+func flattenNumeric(m map[string]any, prefix string) map[string]float64 {
+	out := make(map[string]float64)
+	for k, v := range m {
+		name := k
+		if prefix != "" {
+			name = prefix + "_" + k
+		}
+		switch val := v.(type) {
+		case map[string]any:
+			for nk, nv := range flattenNumeric(val, name) {
+				out[nk] = nv
+			}
+		case float64:
+			out[name] = val
+		case json.Number:
+			f, err := val.Float64()
+			if err == nil {
+				out[name] = f
+			}
+		case bool:
+			if val {
+				out[name] = 1
+			} else {
+				out[name] = 0
+			}
+		}
+	}
+	return out
+}
+
+// mapKeys returns the fully-qualified (underscore-joined) set of leaf key
+// names reachable from m, recursing into nested objects. It does not filter
+// by value type; it is used to enumerate the universe of candidate metric
+// names independent of how each leaf is eventually rendered.
+func mapKeys(m map[string]any, prefix string) map[string]struct{} {
+	keys := make(map[string]struct{})
+	for k, v := range m {
+		name := k
+		if prefix != "" {
+			name = prefix + "_" + k
+		}
+		if nested, ok := v.(map[string]any); ok {
+			for nk := range mapKeys(nested, name) {
+				keys[nk] = struct{}{}
+			}
+			continue
+		}
+		keys[name] = struct{}{}
+	}
+	return keys
+}
+
+// GetServerIDFromVarz fetches /varz at url and returns the server_id field,
+// or an empty string if it could not be retrieved within timeout.
+func GetServerIDFromVarz(url string, timeout time.Duration) string {
+	varz, err := fetchVarz(url, timeout)
+	if err != nil {
+		return ""
+	}
+	return stringField(varz, "server_id")
+}
+
+// GetServerNameFromVarz fetches /varz at url and returns the name field, or
+// an empty string if it could not be retrieved within timeout.
+func GetServerNameFromVarz(url string, timeout time.Duration) string {
+	varz, err := fetchVarz(url, timeout)
+	if err != nil {
+		return ""
+	}
+	return stringField(varz, "name")
+}
+
+func fetchVarz(url string, timeout time.Duration) (map[string]any, error) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(strings.TrimRight(url, "/") + "/varz")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s/varz", resp.StatusCode, url)
+	}
+
+	var varz map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&varz); err != nil {
+		return nil, err
+	}
+	return varz, nil
+}
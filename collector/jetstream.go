@@ -0,0 +1,227 @@
+// Copyright 2017-2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// aggregationKind is how a raw JetStream metric combines across the
+// objects (streams, consumers, accounts) that share a parent.
+type aggregationKind string
+
+const (
+	aggSum aggregationKind = "sum"
+	aggMax aggregationKind = "max"
+	aggAvg aggregationKind = "avg"
+)
+
+// Rollup levels a raw metric can be aggregated to, beyond the partition
+// (stream/consumer, or account when the source is already account-scoped)
+// level it was observed at.
+const (
+	levelPartition = "partition"
+	levelAccount   = "account"
+	levelCluster   = "cluster"
+)
+
+// aggregationRule declares how one raw JetStream metric name rolls up.
+// Counters (messages, bytes, ...) sum across their parent; gauges like
+// num_replicas take the max; a rate-like field can be averaged across its
+// parent with aggAvg. Anything not listed in jetstreamAggregationRules at
+// all is reported at its native level only and never rolled up.
+type aggregationRule struct {
+	aggregation aggregationKind
+	levels      []string
+}
+
+// jetstreamAggregationRules is the declarative policy table driving the
+// account- and cluster-level roll-ups for the jsz/accounts collectors.
+var jetstreamAggregationRules = map[string]aggregationRule{
+	"memory_used":  {aggregation: aggSum, levels: []string{levelPartition, levelAccount, levelCluster}},
+	"storage_used": {aggregation: aggSum, levels: []string{levelPartition, levelAccount, levelCluster}},
+	"max_memory":   {aggregation: aggSum, levels: []string{levelPartition, levelAccount, levelCluster}},
+	"max_storage":  {aggregation: aggSum, levels: []string{levelPartition, levelAccount, levelCluster}},
+	"messages":     {aggregation: aggSum, levels: []string{levelPartition, levelAccount, levelCluster}},
+	"bytes":        {aggregation: aggSum, levels: []string{levelPartition, levelAccount, levelCluster}},
+	"num_replicas": {aggregation: aggMax, levels: []string{levelPartition, levelAccount, levelCluster}},
+}
+
+func hasLevel(levels []string, level string) bool {
+	for _, l := range levels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// rollupTotals accumulates, per metric name, enough state to produce any of
+// the three aggregation kinds (sum, max, avg) once every contributing value
+// has been added.
+type rollupTotals struct {
+	kinds  map[string]aggregationKind
+	sums   map[string]float64
+	maxes  map[string]float64
+	counts map[string]int
+}
+
+func newRollupTotals() *rollupTotals {
+	return &rollupTotals{
+		kinds:  make(map[string]aggregationKind),
+		sums:   make(map[string]float64),
+		maxes:  make(map[string]float64),
+		counts: make(map[string]int),
+	}
+}
+
+func (r *rollupTotals) add(field string, kind aggregationKind, val float64) {
+	r.kinds[field] = kind
+	r.sums[field] += val
+	r.counts[field]++
+	if r.counts[field] == 1 || val > r.maxes[field] {
+		r.maxes[field] = val
+	}
+}
+
+// values resolves every field seen by add into its rolled-up value,
+// applying that field's aggregation kind.
+func (r *rollupTotals) values() map[string]float64 {
+	out := make(map[string]float64, len(r.kinds))
+	for field, kind := range r.kinds {
+		switch kind {
+		case aggMax:
+			out[field] = r.maxes[field]
+		case aggAvg:
+			out[field] = r.sums[field] / float64(r.counts[field])
+		default: // aggSum
+			out[field] = r.sums[field]
+		}
+	}
+	return out
+}
+
+// buildAccountsMetrics reports the raw per-account JetStream usage fields
+// exposed by /accounts (max_memory, max_storage, memory_used,
+// storage_used, ...) and, per jetstreamAggregationRules, a cluster-wide
+// roll-up summed across every account on the server.
+func (nc *NATSCollector) buildAccountsMetrics(s *CollectedServer, raw map[string]any) []prometheus.Metric {
+	accounts, _ := raw["accounts"].([]any)
+
+	var metrics []prometheus.Metric
+	cluster := newRollupTotals()
+
+	for _, a := range accounts {
+		account, ok := a.(map[string]any)
+		if !ok {
+			continue
+		}
+		name := stringField(account, "name")
+		labels := prometheus.Labels{"server_id": s.ID, "account": name}
+
+		for field, val := range flattenNumeric(account, "") {
+			metrics = append(metrics, nc.newGaugeFQ("account_"+field, val, labels))
+
+			if rule, tracked := jetstreamAggregationRules[field]; tracked && hasLevel(rule.levels, levelCluster) {
+				cluster.add(field, rule.aggregation, val)
+			}
+		}
+	}
+
+	for field, val := range cluster.values() {
+		metrics = append(metrics, nc.newGaugeFQ("cluster_"+field, val, prometheus.Labels{"server_id": s.ID}))
+	}
+
+	return metrics
+}
+
+// buildJszMetrics reports server-wide JetStream totals from the top level
+// of /jsz, then, when invoked with ?accounts=true&streams=true&consumers=true,
+// walks each account's streams and consumers to emit the existing
+// per-stream/per-consumer gauges plus account- and cluster-level roll-ups
+// of the metrics listed in jetstreamAggregationRules.
+func (nc *NATSCollector) buildJszMetrics(s *CollectedServer, raw map[string]any) []prometheus.Metric {
+	serverLabels := prometheus.Labels{"server_id": s.ID}
+
+	topLevel := make(map[string]any, len(raw))
+	for k, v := range raw {
+		if k != "account_details" {
+			topLevel[k] = v
+		}
+	}
+
+	var metrics []prometheus.Metric
+	for name, val := range flattenNumeric(topLevel, "") {
+		metrics = append(metrics, nc.newGaugeFQ("server_"+name, val, serverLabels))
+	}
+
+	accountDetails, _ := raw["account_details"].([]any)
+	cluster := newRollupTotals()
+
+	for _, a := range accountDetails {
+		account, ok := a.(map[string]any)
+		if !ok {
+			continue
+		}
+		accountName := stringField(account, "name")
+		accountTotals := newRollupTotals()
+
+		streams, _ := account["stream_detail"].([]any)
+		for _, st := range streams {
+			stream, ok := st.(map[string]any)
+			if !ok {
+				continue
+			}
+			streamName := stringField(stream, "name")
+			streamLabels := prometheus.Labels{"server_id": s.ID, "account": accountName, "stream": streamName}
+
+			state, _ := stream["state"].(map[string]any)
+			for field, val := range flattenNumeric(state, "") {
+				metrics = append(metrics, nc.newGaugeFQ("stream_"+field, val, streamLabels))
+				if rule, tracked := jetstreamAggregationRules[field]; tracked && hasLevel(rule.levels, levelAccount) {
+					accountTotals.add(field, rule.aggregation, val)
+				}
+			}
+
+			consumers, _ := stream["consumer_detail"].([]any)
+			for _, c := range consumers {
+				consumer, ok := c.(map[string]any)
+				if !ok {
+					continue
+				}
+				consumerName := stringField(consumer, "name")
+				consumerLabels := prometheus.Labels{"server_id": s.ID, "account": accountName, "stream": streamName, "consumer": consumerName}
+
+				for field, val := range flattenNumeric(consumer, "") {
+					metrics = append(metrics, nc.newGaugeFQ("consumer_"+field, val, consumerLabels))
+					if rule, tracked := jetstreamAggregationRules[field]; tracked && hasLevel(rule.levels, levelAccount) {
+						accountTotals.add(field, rule.aggregation, val)
+					}
+				}
+			}
+		}
+
+		accountLabels := prometheus.Labels{"server_id": s.ID, "account": accountName}
+		for field, val := range accountTotals.values() {
+			metrics = append(metrics, nc.newGaugeFQ("account_"+field, val, accountLabels))
+			if hasLevel(jetstreamAggregationRules[field].levels, levelCluster) {
+				cluster.add(field, jetstreamAggregationRules[field].aggregation, val)
+			}
+		}
+	}
+
+	for field, val := range cluster.values() {
+		metrics = append(metrics, nc.newGaugeFQ("cluster_"+field, val, serverLabels))
+	}
+
+	return metrics
+}
@@ -0,0 +1,182 @@
+// Copyright 2017-2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pet "github.com/nats-io/prometheus-nats-exporter/test"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// TestJetStreamAccountClusterRollup verifies that the per-account
+// memory_used values in pet.JszAccountsTestResponse() roll up into a
+// single jetstream_cluster_memory_used gauge.
+func TestJetStreamAccountClusterRollup(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/varz":
+			fmt.Fprintln(w, `{"server_id":"SERVER_ID","name":"nats-server"}`)
+		case "/jsz":
+			fmt.Fprintln(w, pet.JszAccountsTestResponse())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	servers := []*CollectedServer{{ID: "SERVER_ID", URL: ts.URL}}
+	nc := NewCollector(JetStreamSystem, "accounts", "", servers)
+
+	const clusterMetric = "jetstream_cluster_memory_used"
+	const wantTotal = 234567890 + 123456789
+
+	c := make(chan prometheus.Metric)
+	go nc.Collect(c)
+
+	for {
+		select {
+		case metric := <-c:
+			pb := &dto.Metric{}
+			if err := metric.Write(pb); err != nil {
+				t.Fatalf("unable to write metric: %v", err)
+			}
+			if parseDesc(metric.Desc().String()) == clusterMetric {
+				if got := pb.GetGauge().GetValue(); got != wantTotal {
+					t.Fatalf("expected %s=%v, got %v", clusterMetric, wantTotal, got)
+				}
+				return
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatalf("did not observe %s", clusterMetric)
+		}
+	}
+}
+
+// jszNestedTestResponse is a synthetic /jsz?accounts=true&streams=true&
+// consumers=true response with two streams split across two accounts, each
+// with one consumer, used to exercise the per-stream/per-consumer walk in
+// buildJszMetrics. first_seq/last_seq are included even though they are not
+// in jetstreamAggregationRules, to confirm they still get a base gauge.
+const jszNestedTestResponse = `{
+	"total_streams": 2,
+	"total_consumers": 2,
+	"account_details": [
+		{
+			"name": "account1",
+			"stream_detail": [
+				{
+					"name": "foo",
+					"state": {"messages": 10, "bytes": 100, "first_seq": 1, "last_seq": 10},
+					"consumer_detail": [
+						{"name": "c1", "num_pending": 2, "num_ack_pending": 1}
+					]
+				}
+			]
+		},
+		{
+			"name": "account2",
+			"stream_detail": [
+				{
+					"name": "bar",
+					"state": {"messages": 5, "bytes": 50, "first_seq": 1, "last_seq": 5},
+					"consumer_detail": [
+						{"name": "c2", "num_pending": 0, "num_ack_pending": 0}
+					]
+				}
+			]
+		}
+	]
+}`
+
+// TestJetStreamMetricsNested verifies the nested jsz walk: a base gauge is
+// emitted per stream/consumer field regardless of whether it appears in
+// jetstreamAggregationRules, and the tracked fields (messages, bytes) roll
+// up correctly to the account and cluster levels.
+func TestJetStreamMetricsNested(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, jszNestedTestResponse)
+	}))
+	defer ts.Close()
+
+	servers := []*CollectedServer{{ID: "SERVER_ID", URL: ts.URL}}
+	nc := NewCollector(JetStreamSystem, "jsz", "", servers)
+
+	values := make(map[string][]float64)
+	c := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for metric := range c {
+			pb := &dto.Metric{}
+			if err := metric.Write(pb); err != nil {
+				t.Errorf("unable to write metric: %v", err)
+				return
+			}
+			name := parseDesc(metric.Desc().String())
+			values[name] = append(values[name], pb.GetGauge().GetValue())
+		}
+	}()
+	nc.Collect(c)
+	close(c)
+	<-done
+
+	cases := map[string]float64{
+		"jetstream_stream_messages":      15, // one value per stream: 10 and 5
+		"jetstream_consumer_num_pending": 2,  // one value per consumer: 2 and 0
+		"jetstream_account_messages":     10, // account1's rollup (account2's is 5)
+		"jetstream_cluster_messages":     15, // 10 + 5 across both accounts
+	}
+	for name, want := range cases {
+		got, found := values[name]
+		if !found {
+			t.Fatalf("no metric %s was emitted at all", name)
+		}
+		switch name {
+		case "jetstream_stream_messages", "jetstream_consumer_num_pending":
+			var sum float64
+			for _, v := range got {
+				sum += v
+			}
+			if sum != want {
+				t.Fatalf("expected %s values to sum to %v, got %v", name, want, got)
+			}
+		default:
+			found := false
+			for _, v := range got {
+				if v == want {
+					found = true
+				}
+			}
+			if !found {
+				t.Fatalf("expected one %s value of %v, got %v", name, want, got)
+			}
+		}
+	}
+
+	// first_seq/last_seq are not in jetstreamAggregationRules, but the base
+	// per-stream gauge must still be emitted for them.
+	for _, name := range []string{"jetstream_stream_first_seq", "jetstream_stream_last_seq"} {
+		if _, found := values[name]; !found {
+			t.Fatalf("expected untracked field %s to still get a base gauge", name)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2017-2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logrusadapter adapts a logrus.FieldLogger to collector.Logger.
+package logrusadapter
+
+import "github.com/sirupsen/logrus"
+
+// Adapter wraps a logrus.FieldLogger so it can be passed to
+// collector.WithLogger.
+type Adapter struct {
+	L logrus.FieldLogger
+}
+
+// New returns a collector.Logger backed by l.
+func New(l logrus.FieldLogger) *Adapter {
+	return &Adapter{L: l}
+}
+
+func (a *Adapter) Debugf(format string, args ...any) { a.L.Debugf(format, args...) }
+func (a *Adapter) Infof(format string, args ...any)  { a.L.Infof(format, args...) }
+func (a *Adapter) Warnf(format string, args ...any)  { a.L.Warnf(format, args...) }
+func (a *Adapter) Errorf(format string, args ...any) { a.L.Errorf(format, args...) }
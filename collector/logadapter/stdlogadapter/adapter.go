@@ -0,0 +1,35 @@
+// Copyright 2017-2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stdlogadapter adapts the standard library's *log.Logger to
+// collector.Logger.
+package stdlogadapter
+
+import "log"
+
+// Adapter wraps a *log.Logger so it can be passed to collector.WithLogger.
+// The standard logger has no notion of level, so every call is printed
+// with a level prefix.
+type Adapter struct {
+	L *log.Logger
+}
+
+// New returns a collector.Logger backed by l.
+func New(l *log.Logger) *Adapter {
+	return &Adapter{L: l}
+}
+
+func (a *Adapter) Debugf(format string, args ...any) { a.L.Printf("[DEBUG] "+format, args...) }
+func (a *Adapter) Infof(format string, args ...any)  { a.L.Printf("[INFO] "+format, args...) }
+func (a *Adapter) Warnf(format string, args ...any)  { a.L.Printf("[WARN] "+format, args...) }
+func (a *Adapter) Errorf(format string, args ...any) { a.L.Printf("[ERROR] "+format, args...) }
@@ -0,0 +1,48 @@
+// Copyright 2017-2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+// Logger receives the collector's diagnostic output: failed fetches and
+// unparseable responses at warn level, per-metric emission traces at debug
+// level. Missing label values are not reported. Any
+// leveled logger with this shape can be adapted to it; see the stdlog,
+// logrus, and zap adapters under collector/logadapter for ready-made ones.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// noopLogger is the default Logger used when NewCollector is not given
+// WithLogger, preserving the library's historical silence by default.
+type noopLogger struct{}
+
+func (noopLogger) Debugf(string, ...any) {}
+func (noopLogger) Infof(string, ...any)  {}
+func (noopLogger) Warnf(string, ...any)  {}
+func (noopLogger) Errorf(string, ...any) {}
+
+// Option configures a NATSCollector constructed via NewCollector.
+type Option func(*NATSCollector)
+
+// WithLogger routes the collector's diagnostics to l instead of the
+// default no-op logger.
+func WithLogger(l Logger) Option {
+	return func(nc *NATSCollector) {
+		if l != nil {
+			nc.logger = l
+		}
+	}
+}
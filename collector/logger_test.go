@@ -0,0 +1,109 @@
+// Copyright 2017-2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// captureLogger is a fake Logger that records every line passed to it, for
+// assertions in tests.
+type captureLogger struct {
+	mu    sync.Mutex
+	debug []string
+	warn  []string
+}
+
+func (c *captureLogger) Debugf(format string, args ...any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.debug = append(c.debug, fmt.Sprintf(format, args...))
+}
+
+func (c *captureLogger) Infof(format string, args ...any) {}
+
+func (c *captureLogger) Warnf(format string, args ...any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warn = append(c.warn, fmt.Sprintf(format, args...))
+}
+
+func (c *captureLogger) Errorf(format string, args ...any) {}
+
+func (c *captureLogger) contains(lines []string, substr string) bool {
+	for _, l := range lines {
+		if strings.Contains(l, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWithLoggerWarnsOn5xx(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	logger := &captureLogger{}
+	servers := []*CollectedServer{{ID: "id", URL: ts.URL}}
+	nc := NewCollector(CoreSystem, "varz", "", servers, WithLogger(logger))
+
+	c := make(chan prometheus.Metric, 4)
+	nc.Collect(c)
+	close(c)
+	for range c {
+	}
+
+	if !logger.contains(logger.warn, ts.URL) {
+		t.Fatalf("expected a warn line mentioning the failing server, got: %v", logger.warn)
+	}
+}
+
+func TestWithLoggerDebugsPerMetric(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"connections":1}`)
+	}))
+	defer ts.Close()
+
+	logger := &captureLogger{}
+	servers := []*CollectedServer{{ID: "id", URL: ts.URL}}
+	nc := NewCollector(CoreSystem, "varz", "", servers, WithLogger(logger))
+
+	c := make(chan prometheus.Metric, 4)
+	nc.Collect(c)
+	close(c)
+	for range c {
+	}
+
+	if !logger.contains(logger.debug, "gnatsd_varz_connections") {
+		t.Fatalf("expected a debug line per emitted metric, got: %v", logger.debug)
+	}
+}
+
+func TestDefaultLoggerIsSilent(t *testing.T) {
+	servers := []*CollectedServer{{ID: "id", URL: "http://127.0.0.1:1"}}
+	nc := NewCollector(CoreSystem, "varz", "", servers).(*NATSCollector)
+	if _, ok := nc.logger.(noopLogger); !ok {
+		t.Fatalf("expected default logger to be noopLogger, got %T", nc.logger)
+	}
+}
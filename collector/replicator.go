@@ -0,0 +1,49 @@
+// Copyright 2017-2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// replicatorEndpoints is consulted by NATSCollector.buildMetrics to decide
+// whether a ReplicatorSystem collector's endpoint should be routed to
+// buildReplicatorMetrics. CoreSystem and JetStreamSystem endpoints have no
+// such table; buildMetrics dispatches them by endpoint name alone.
+var replicatorEndpoints = map[string]bool{
+	"varz": true,
+}
+
+// buildReplicatorMetrics reports one gauge per numeric field of every
+// connector in a nats-replicator /varz response, labeled by that
+// connector's id and name plus server_id — the same pattern leafz uses to
+// label its per-connection metrics.
+func (nc *NATSCollector) buildReplicatorMetrics(s *CollectedServer, raw map[string]any) []prometheus.Metric {
+	connectors, _ := raw["connectors"].([]any)
+
+	var metrics []prometheus.Metric
+	for _, c := range connectors {
+		connector, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		labels := prometheus.Labels{
+			"server_id":      s.ID,
+			"connector_id":   stringField(connector, "id"),
+			"connector_name": stringField(connector, "name"),
+		}
+		for field, val := range flattenNumeric(connector, "") {
+			metrics = append(metrics, nc.newGauge("connector_"+field, val, labels))
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,139 @@
+// Copyright 2017-2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	pet "github.com/nats-io/prometheus-nats-exporter/test"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestReplicatorMetrics(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	s := pet.RunReplicatorStaticServer(&wg)
+	defer s.Close()
+
+	url := fmt.Sprintf("http://localhost:%d", pet.StaticPort)
+
+	msgsIn := "nats_replicator_varz_connector_messages_in"
+	labelValues, err := getLabelValues(ReplicatorSystem, url, "varz", []string{msgsIn})
+	if err != nil {
+		t.Fatalf("unexpected error getting labels for %s metrics: %v", msgsIn, err)
+	}
+
+	labelMaps, found := labelValues[msgsIn]
+	if !found || len(labelMaps) != 2 {
+		t.Fatalf("no info found for metric %s", msgsIn)
+	}
+
+	expectedLabelMaps := []map[string]string{
+		{"connector_id": "c1", "connector_name": "conn-a", "server_id": "id"},
+		{"connector_id": "c2", "connector_name": "conn-b", "server_id": "id"},
+	}
+
+	expectedLabelsNotFound := make(map[string]string)
+	for _, expLabelMap := range expectedLabelMaps {
+		for expLabel, expValue := range expLabelMap {
+			flag := false
+			for _, labelMap := range labelMaps {
+				if value, ok := labelMap[expLabel]; ok && value == expValue {
+					flag = true
+					break
+				}
+			}
+			if !flag {
+				expectedLabelsNotFound[expLabel] = expValue
+			}
+		}
+	}
+	if len(expectedLabelsNotFound) > 0 {
+		t.Fatalf("the following expected labels were missing: %v", expectedLabelsNotFound)
+	}
+
+	// Expected values straight from replicatorVarzTestResponse, keyed by
+	// connector id, so a bug that corrupts a connector's numbers (wrong
+	// field picked up, off-by-one in aggregation, ...) doesn't pass
+	// silently.
+	wantByConnector := map[string]map[string]float64{
+		"c1": {
+			"nats_replicator_varz_connector_connects":     3,
+			"nats_replicator_varz_connector_disconnects":  1,
+			"nats_replicator_varz_connector_messages_in":  120,
+			"nats_replicator_varz_connector_bytes_in":     2048,
+			"nats_replicator_varz_connector_messages_out": 118,
+			"nats_replicator_varz_connector_bytes_out":    2010,
+		},
+		"c2": {
+			"nats_replicator_varz_connector_connects":     1,
+			"nats_replicator_varz_connector_disconnects":  0,
+			"nats_replicator_varz_connector_messages_in":  45,
+			"nats_replicator_varz_connector_bytes_in":     900,
+			"nats_replicator_varz_connector_messages_out": 45,
+			"nats_replicator_varz_connector_bytes_out":    900,
+		},
+	}
+
+	servers := []*CollectedServer{{ID: "id", URL: url}}
+	nc := NewCollector(ReplicatorSystem, "varz", "", servers)
+
+	seen := make(map[string]map[string]bool)
+	c := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for metric := range c {
+			pb := &dto.Metric{}
+			if err := metric.Write(pb); err != nil {
+				t.Errorf("unable to write metric: %v", err)
+				return
+			}
+
+			var connectorID string
+			for _, label := range pb.GetLabel() {
+				if label.GetName() == "connector_id" {
+					connectorID = label.GetValue()
+				}
+			}
+
+			name := parseDesc(metric.Desc().String())
+			want, tracked := wantByConnector[connectorID][name]
+			if !tracked {
+				continue
+			}
+			if got := pb.GetGauge().GetValue(); got != want {
+				t.Errorf("connector %s: expected %s=%v, got %v", connectorID, name, want, got)
+			}
+			if seen[connectorID] == nil {
+				seen[connectorID] = make(map[string]bool)
+			}
+			seen[connectorID][name] = true
+		}
+	}()
+	nc.Collect(c)
+	close(c)
+	<-done
+
+	for connectorID, fields := range wantByConnector {
+		for name := range fields {
+			if !seen[connectorID][name] {
+				t.Fatalf("expected to see %s for connector %s, but it was never emitted", name, connectorID)
+			}
+		}
+	}
+}
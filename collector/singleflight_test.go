@@ -0,0 +1,102 @@
+// Copyright 2017-2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestCollectCoalescesConcurrentScrapes verifies that overlapping Collect
+// calls against the same endpoint share a single upstream HTTP request. The
+// staleness window is disabled and the handler is made deliberately slow so
+// every goroutine is forced to race into fetch's singleflight.Group while
+// the cache is cold, rather than all being served from a warm cache entry.
+func TestCollectCoalescesConcurrentScrapes(t *testing.T) {
+	var requests int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"connections":1}`)
+	}))
+	defer ts.Close()
+
+	servers := []*CollectedServer{{ID: "id", URL: ts.URL}}
+	nc := NewCollector(CoreSystem, "varz", "", servers, WithStaleness(0))
+
+	// NewCollector already issued one probe request while populating Stats;
+	// only count the requests made by the concurrent Collect calls below.
+	atomic.StoreInt32(&requests, 0)
+
+	const n = 25
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			c := make(chan prometheus.Metric, 16)
+			nc.Collect(c)
+			close(c)
+			for range c {
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Fatalf("expected exactly 1 upstream request for coalesced scrapes, got %d", got)
+	}
+}
+
+// TestCollectRefetchesAfterStaleness verifies that once the staleness
+// window for a cached result elapses, Collect issues a fresh request.
+func TestCollectRefetchesAfterStaleness(t *testing.T) {
+	var requests int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"connections":1}`)
+	}))
+	defer ts.Close()
+
+	servers := []*CollectedServer{{ID: "id", URL: ts.URL}}
+	nc := NewCollector(CoreSystem, "varz", "", servers).(*NATSCollector)
+	nc.staleness = 0
+
+	// NewCollector already issued one probe request while populating Stats;
+	// only count the requests made by the Collect calls below.
+	atomic.StoreInt32(&requests, 0)
+
+	for i := 0; i < 3; i++ {
+		c := make(chan prometheus.Metric, 16)
+		nc.Collect(c)
+		close(c)
+		for range c {
+		}
+	}
+
+	if got := atomic.LoadInt32(&requests); got != 3 {
+		t.Fatalf("expected a fresh request per Collect once staleness is disabled, got %d", got)
+	}
+}
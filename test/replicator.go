@@ -0,0 +1,71 @@
+// Copyright 2017-2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// replicatorVarzTestResponse is a canned nats-replicator /varz body with two
+// connectors, used to exercise the replicator collector's label handling.
+const replicatorVarzTestResponse = `{
+	"server_id": "id",
+	"connectors": [
+		{
+			"id": "c1",
+			"name": "conn-a",
+			"connects": 3,
+			"disconnects": 1,
+			"messages_in": 120,
+			"bytes_in": 2048,
+			"messages_out": 118,
+			"bytes_out": 2010
+		},
+		{
+			"id": "c2",
+			"name": "conn-b",
+			"connects": 1,
+			"disconnects": 0,
+			"messages_in": 45,
+			"bytes_in": 900,
+			"messages_out": 45,
+			"bytes_out": 900
+		}
+	]
+}`
+
+// RunReplicatorStaticServer serves replicatorVarzTestResponse at /varz on
+// StaticPort (other paths get 404), signaling wg.Done() once it is ready to accept
+// connections, mirroring RunLeafzStaticServer.
+func RunReplicatorStaticServer(wg *sync.WaitGroup) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/varz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, replicatorVarzTestResponse)
+	})
+
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", StaticPort), Handler: mux}
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		panic(err)
+	}
+
+	go srv.Serve(ln)
+	wg.Done()
+
+	return srv
+}